@@ -0,0 +1,260 @@
+// Package fakenet provides an in-memory net.PacketConn implementation for
+// exercising the reliability guarantees this project claims (retransmit,
+// reordering recovery, SACK) without binding real UDP sockets. Real sockets
+// make loss/reorder/latency scenarios flaky and slow to test; a fake
+// transport makes them deterministic and fast, the same pattern the Go
+// stdlib uses for its own network tests.
+package fakenet
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrNoPeer is returned by WriteTo when the endpoint's peer was never wired
+// up via Pipe.
+var ErrNoPeer = errors.New("fakenet: endpoint has no peer")
+
+// Config controls the impairments a Pipe applies to every datagram written
+// into it.
+type Config struct {
+	// DropProbability is the chance, in [0,1], that a written datagram is
+	// silently discarded, as UDP would under congestion.
+	DropProbability float64
+
+	// DuplicateProbability is the chance, in [0,1], that a written
+	// datagram is delivered twice.
+	DuplicateProbability float64
+
+	// Delay is the fixed latency applied to every delivered datagram.
+	Delay time.Duration
+
+	// Jitter adds up to this much additional random latency on top of
+	// Delay, independently per datagram, which is what actually produces
+	// reordering between two datagrams written back-to-back.
+	Jitter time.Duration
+
+	// ReorderWindow is how many in-flight datagrams an endpoint may hold
+	// back before being forced to release one, picked at random rather
+	// than in arrival order. A window of 0 disables this extra reordering
+	// (Jitter alone can still reorder datagrams).
+	ReorderWindow int
+
+	// Rand seeds the impairment decisions above. If nil, a source seeded
+	// from a fixed value is used so tests stay deterministic.
+	Rand *rand.Rand
+}
+
+// Addr identifies one end of a Pipe.
+type Addr string
+
+func (a Addr) Network() string { return "fakenet" }
+func (a Addr) String() string  { return string(a) }
+
+type datagram struct {
+	data []byte
+	from net.Addr
+}
+
+// safeRand wraps a *rand.Rand with a mutex: math/rand.Rand is not safe for
+// concurrent use, and an Endpoint's rng is read both from whatever
+// goroutine calls WriteTo and from the deliverAfter goroutines it spawns
+// (which call hold on the peer).
+type safeRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func (s *safeRand) Float64() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Float64()
+}
+
+func (s *safeRand) Int63n(n int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Int63n(n)
+}
+
+func (s *safeRand) Intn(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Intn(n)
+}
+
+// Endpoint is one side of a Pipe. It implements net.PacketConn so it can be
+// injected anywhere a *net.UDPConn is used today.
+type Endpoint struct {
+	addr Addr
+	cfg  Config
+	rng  *safeRand
+
+	peerMu sync.Mutex
+	peer   *Endpoint
+
+	mu           sync.Mutex
+	held         []datagram
+	readDeadline time.Time
+
+	inbox     chan datagram
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+var _ net.PacketConn = (*Endpoint)(nil)
+
+// Pipe returns two connected endpoints, each named by addr, that route
+// datagrams to each other subject to the impairments in cfg. Each endpoint
+// gets its own independent rng, seeded deterministically off cfg.Rand (or a
+// fixed default) so a given cfg still reproduces the same run, without the
+// two endpoints ever touching the same *rand.Rand from different
+// goroutines.
+func Pipe(addrA, addrB string, cfg Config) (a, b *Endpoint) {
+	seedSrc := cfg.Rand
+	if seedSrc == nil {
+		seedSrc = rand.New(rand.NewSource(1))
+	}
+	rngA := &safeRand{r: rand.New(rand.NewSource(seedSrc.Int63()))}
+	rngB := &safeRand{r: rand.New(rand.NewSource(seedSrc.Int63()))}
+	a = &Endpoint{addr: Addr(addrA), cfg: cfg, rng: rngA, inbox: make(chan datagram, 64), closed: make(chan struct{})}
+	b = &Endpoint{addr: Addr(addrB), cfg: cfg, rng: rngB, inbox: make(chan datagram, 64), closed: make(chan struct{})}
+	a.peer, b.peer = b, a
+	return a, b
+}
+
+// WriteTo queues data for delivery to the peer endpoint, applying this
+// Pipe's drop/duplicate/delay/reorder configuration. It never blocks on the
+// peer draining its inbox; like real UDP, a full inbox just drops.
+func (e *Endpoint) WriteTo(data []byte, _ net.Addr) (int, error) {
+	select {
+	case <-e.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	e.peerMu.Lock()
+	peer := e.peer
+	e.peerMu.Unlock()
+	if peer == nil {
+		return 0, ErrNoPeer
+	}
+
+	e.mu.Lock()
+	cfg := e.cfg
+	e.mu.Unlock()
+
+	copies := 1
+	if cfg.DuplicateProbability > 0 && e.rng.Float64() < cfg.DuplicateProbability {
+		copies = 2
+	}
+	for i := 0; i < copies; i++ {
+		if cfg.DropProbability > 0 && e.rng.Float64() < cfg.DropProbability {
+			continue
+		}
+		payload := append([]byte(nil), data...)
+		delay := cfg.Delay
+		if cfg.Jitter > 0 {
+			delay += time.Duration(e.rng.Int63n(int64(cfg.Jitter)))
+		}
+		go e.deliverAfter(peer, datagram{data: payload, from: e.addr}, delay)
+	}
+	return len(data), nil
+}
+
+// SetDropProbability updates the endpoint's drop probability at runtime,
+// letting a test blackhole a path mid-transfer without tearing down the
+// Pipe.
+func (e *Endpoint) SetDropProbability(p float64) {
+	e.mu.Lock()
+	e.cfg.DropProbability = p
+	e.mu.Unlock()
+}
+
+func (e *Endpoint) deliverAfter(peer *Endpoint, d datagram, delay time.Duration) {
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	peer.hold(d)
+}
+
+// hold buffers an arriving datagram and, once more than ReorderWindow
+// datagrams are held, releases one chosen at random into the inbox -
+// datagrams written close together can then be delivered out of order.
+func (e *Endpoint) hold(d datagram) {
+	e.mu.Lock()
+	window := e.cfg.ReorderWindow
+	e.held = append(e.held, d)
+	var release *datagram
+	if len(e.held) > window {
+		idx := e.rng.Intn(len(e.held))
+		picked := e.held[idx]
+		e.held = append(e.held[:idx], e.held[idx+1:]...)
+		release = &picked
+	}
+	e.mu.Unlock()
+
+	if release != nil {
+		select {
+		case e.inbox <- *release:
+		case <-e.closed:
+		}
+	}
+}
+
+// ReadFrom blocks until a datagram is available, the read deadline set by
+// SetReadDeadline passes, or the endpoint is closed.
+func (e *Endpoint) ReadFrom(p []byte) (int, net.Addr, error) {
+	e.mu.Lock()
+	deadline := e.readDeadline
+	e.mu.Unlock()
+
+	var timeoutC <-chan time.Time
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return 0, nil, timeoutError{}
+		}
+		timer := time.NewTimer(remaining)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+
+	select {
+	case <-e.closed:
+		return 0, nil, net.ErrClosed
+	case d := <-e.inbox:
+		n := copy(p, d.data)
+		return n, d.from, nil
+	case <-timeoutC:
+		return 0, nil, timeoutError{}
+	}
+}
+
+func (e *Endpoint) SetReadDeadline(t time.Time) error {
+	e.mu.Lock()
+	e.readDeadline = t
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *Endpoint) SetDeadline(t time.Time) error      { return e.SetReadDeadline(t) }
+func (e *Endpoint) SetWriteDeadline(time.Time) error   { return nil }
+func (e *Endpoint) LocalAddr() net.Addr                { return e.addr }
+
+func (e *Endpoint) Close() error {
+	e.closeOnce.Do(func() { close(e.closed) })
+	return nil
+}
+
+// timeoutError satisfies net.Error so callers that type-assert on Timeout()
+// (as both FSMs do to distinguish a read deadline from a real failure)
+// behave the same as they do against a real *net.UDPConn.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "fakenet: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,98 @@
+package fakenet
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestPipeDeliversDatagram(t *testing.T) {
+	a, b := Pipe("a", "b", Config{})
+	defer a.Close()
+	defer b.Close()
+
+	if _, err := a.WriteTo([]byte("hello"), b.LocalAddr()); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	b.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 16)
+	n, from, err := b.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Fatalf("got %q, want %q", buf[:n], "hello")
+	}
+	if from.String() != "a" {
+		t.Fatalf("got sender %q, want %q", from, "a")
+	}
+}
+
+func TestPipeReadFromTimesOut(t *testing.T) {
+	a, b := Pipe("a", "b", Config{})
+	defer a.Close()
+	defer b.Close()
+
+	b.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	_, _, err := b.ReadFrom(make([]byte, 16))
+	netErr, ok := err.(interface{ Timeout() bool })
+	if !ok || !netErr.Timeout() {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestPipeDropsAccordingToProbability(t *testing.T) {
+	a, b := Pipe("a", "b", Config{DropProbability: 1, Rand: rand.New(rand.NewSource(1))})
+	defer a.Close()
+	defer b.Close()
+
+	a.WriteTo([]byte("dropped"), b.LocalAddr())
+	b.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, _, err := b.ReadFrom(make([]byte, 16)); err == nil {
+		t.Fatalf("expected the datagram to be dropped, but it was delivered")
+	}
+}
+
+func TestPipeDuplicatesAccordingToProbability(t *testing.T) {
+	a, b := Pipe("a", "b", Config{DuplicateProbability: 1, Rand: rand.New(rand.NewSource(1))})
+	defer a.Close()
+	defer b.Close()
+
+	a.WriteTo([]byte("x"), b.LocalAddr())
+	b.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 16)
+	for i := 0; i < 2; i++ {
+		if _, _, err := b.ReadFrom(buf); err != nil {
+			t.Fatalf("expected 2 copies, only got %d: %v", i, err)
+		}
+	}
+}
+
+func TestPipeClosedEndpointRejectsWrites(t *testing.T) {
+	a, b := Pipe("a", "b", Config{})
+	defer b.Close()
+	a.Close()
+
+	if _, err := a.WriteTo([]byte("x"), b.LocalAddr()); err == nil {
+		t.Fatalf("expected WriteTo on a closed endpoint to fail")
+	}
+}
+
+func TestSetDropProbabilityBlackholesMidTransfer(t *testing.T) {
+	a, b := Pipe("a", "b", Config{Rand: rand.New(rand.NewSource(1))})
+	defer a.Close()
+	defer b.Close()
+
+	a.WriteTo([]byte("before"), b.LocalAddr())
+	b.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := b.ReadFrom(make([]byte, 16)); err != nil {
+		t.Fatalf("expected datagram sent before blackholing to arrive: %v", err)
+	}
+
+	a.SetDropProbability(1)
+	a.WriteTo([]byte("after"), b.LocalAddr())
+	b.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, _, err := b.ReadFrom(make([]byte, 16)); err == nil {
+		t.Fatalf("expected the datagram sent after blackholing to be dropped")
+	}
+}
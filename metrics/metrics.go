@@ -0,0 +1,300 @@
+// Package metrics decouples both FSMs from any one observability backend.
+// The CSV exporter the receiver shipped with started as a hardcoded
+// 10-second dump living directly on the FSM; as soon as a second
+// consumer (a JSON-lines file, a Prometheus scrape target) wanted the
+// same events, that coupling had to go. A Sink is handed to a FSM via its
+// constructor, the same way DialFunc/ListenFunc are, so tests and the
+// CLI can each wire up whichever backend they need.
+package metrics
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Sink receives the events both FSMs produce as they send/receive
+// segments. Counters are int64 deltas rather than snapshots so
+// implementations can use sync/atomic instead of the fsm-owned,
+// unsynchronized int fields this replaces.
+type Sink interface {
+	IncSent()
+	IncReceived()
+	IncRetransmitted()
+	IncDropped()
+	IncDelivered()
+	ObserveRTT(sample time.Duration)
+	ObserveInterArrival(sample time.Duration)
+	SetCwnd(cwnd float64)
+	SetInFlightBytes(bytes int)
+	Close() error
+}
+
+// NopSink discards every event. It is the default a FSM falls back to
+// when NewWriterFSM/NewReceiverFSM is given a nil Sink, mirroring how a
+// nil DialFunc/ListenFunc falls back to a real socket.
+type NopSink struct{}
+
+func (NopSink) IncSent()                          {}
+func (NopSink) IncReceived()                      {}
+func (NopSink) IncRetransmitted()                 {}
+func (NopSink) IncDropped()                       {}
+func (NopSink) IncDelivered()                     {}
+func (NopSink) ObserveRTT(time.Duration)          {}
+func (NopSink) ObserveInterArrival(time.Duration) {}
+func (NopSink) SetCwnd(float64)                   {}
+func (NopSink) SetInFlightBytes(int)              {}
+func (NopSink) Close() error                      { return nil }
+
+// CSVSink reproduces the original behavior: every 10 seconds it appends a
+// row with the cumulative counters to a CSV file. Counters are held in
+// int64s updated via sync/atomic since, unlike the fsm-owned ints it
+// replaces, several goroutines report events concurrently.
+type CSVSink struct {
+	sent, received, retransmitted, dropped, delivered int64
+
+	file     *os.File
+	writer   *csv.Writer
+	start    time.Time
+	stopChan chan struct{}
+	doneChan chan struct{}
+}
+
+// NewCSVSink creates (or truncates) path and starts the 10-second snapshot
+// loop immediately.
+func NewCSVSink(path string) (*CSVSink, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := csv.NewWriter(file)
+	w.Write([]string{"Time Elapsed", "Packets Sent", "Packets Received", "Retransmitted", "Dropped", "Delivered", "Delivery Rate"})
+
+	s := &CSVSink{
+		file:     file,
+		writer:   w,
+		start:    time.Now(),
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *CSVSink) IncSent()                          { atomic.AddInt64(&s.sent, 1) }
+func (s *CSVSink) IncReceived()                      { atomic.AddInt64(&s.received, 1) }
+func (s *CSVSink) IncRetransmitted()                 { atomic.AddInt64(&s.retransmitted, 1) }
+func (s *CSVSink) IncDropped()                       { atomic.AddInt64(&s.dropped, 1) }
+func (s *CSVSink) IncDelivered()                     { atomic.AddInt64(&s.delivered, 1) }
+func (s *CSVSink) ObserveRTT(time.Duration)          {}
+func (s *CSVSink) ObserveInterArrival(time.Duration) {}
+func (s *CSVSink) SetCwnd(float64)                   {}
+func (s *CSVSink) SetInFlightBytes(int)              {}
+
+func (s *CSVSink) run() {
+	defer close(s.doneChan)
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopChan:
+			s.writeRow()
+			return
+		case <-ticker.C:
+			s.writeRow()
+		}
+	}
+}
+
+func (s *CSVSink) writeRow() {
+	elapsed := int(time.Since(s.start).Seconds())
+	elapsedTimestamp := time.Date(0, 1, 1, 0, 0, elapsed, 0, time.UTC).Format("04:05")
+
+	sent := atomic.LoadInt64(&s.sent)
+	received := atomic.LoadInt64(&s.received)
+	retransmitted := atomic.LoadInt64(&s.retransmitted)
+	dropped := atomic.LoadInt64(&s.dropped)
+	delivered := atomic.LoadInt64(&s.delivered)
+
+	rate := "N/A"
+	if received > 0 {
+		rate = strconv.FormatFloat(float64(delivered)/float64(received)*100, 'f', 2, 64) + "%"
+	}
+
+	s.writer.Write([]string{
+		elapsedTimestamp,
+		strconv.FormatInt(sent, 10),
+		strconv.FormatInt(received, 10),
+		strconv.FormatInt(retransmitted, 10),
+		strconv.FormatInt(dropped, 10),
+		strconv.FormatInt(delivered, 10),
+		rate,
+	})
+	s.writer.Flush()
+}
+
+// Close stops the snapshot loop, writes one final row, and closes the
+// file.
+func (s *CSVSink) Close() error {
+	close(s.stopChan)
+	<-s.doneChan
+	return s.file.Close()
+}
+
+// jsonlEvent is one line of a JSONLSink's output file.
+type jsonlEvent struct {
+	Time  string  `json:"time"`
+	Event string  `json:"event"`
+	Value float64 `json:"value"`
+}
+
+// JSONLSink appends one JSON object per event as it happens, unlike
+// CSVSink's periodic snapshot - useful when a downstream log pipeline
+// wants to ingest individual packet/RTT events rather than a rollup.
+type JSONLSink struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewJSONLSink opens path for appending, creating it if necessary.
+func NewJSONLSink(path string) (*JSONLSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLSink{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (s *JSONLSink) write(event string, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enc.Encode(jsonlEvent{Time: time.Now().UTC().Format(time.RFC3339Nano), Event: event, Value: value})
+}
+
+func (s *JSONLSink) IncSent()                   { s.write("packets_sent", 1) }
+func (s *JSONLSink) IncReceived()               { s.write("packets_received", 1) }
+func (s *JSONLSink) IncRetransmitted()          { s.write("packets_retransmitted", 1) }
+func (s *JSONLSink) IncDropped()                { s.write("packets_dropped", 1) }
+func (s *JSONLSink) IncDelivered()              { s.write("packets_delivered", 1) }
+func (s *JSONLSink) ObserveRTT(d time.Duration) { s.write("rtt_seconds", d.Seconds()) }
+func (s *JSONLSink) ObserveInterArrival(d time.Duration) {
+	s.write("inter_arrival_seconds", d.Seconds())
+}
+func (s *JSONLSink) SetCwnd(v float64)      { s.write("cwnd", v) }
+func (s *JSONLSink) SetInFlightBytes(n int) { s.write("in_flight_bytes", float64(n)) }
+
+func (s *JSONLSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// PrometheusSink registers counters/histograms/gauges on their own
+// registry (not the global DefaultRegisterer, so a writer and a receiver
+// in the same test binary don't collide) and serves them on /metrics.
+type PrometheusSink struct {
+	registry *prometheus.Registry
+	server   *http.Server
+
+	packetsSent          prometheus.Counter
+	packetsReceived      prometheus.Counter
+	packetsRetransmitted prometheus.Counter
+	packetsDropped       prometheus.Counter
+	packetsDelivered     prometheus.Counter
+	rtt                  prometheus.Histogram
+	interArrival         prometheus.Histogram
+	cwnd                 prometheus.Gauge
+	inFlightBytes        prometheus.Gauge
+}
+
+// NewPrometheusSink builds the registry and metrics but does not start
+// listening; call Serve to do that, typically from a goroutine the
+// caller's FSM wait group tracks so shutdown stays clean.
+func NewPrometheusSink(addr string) (*PrometheusSink, error) {
+	registry := prometheus.NewRegistry()
+	s := &PrometheusSink{
+		registry: registry,
+		packetsSent: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "reliable_udp_packets_sent_total", Help: "Total packets sent.",
+		}),
+		packetsReceived: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "reliable_udp_packets_received_total", Help: "Total packets received.",
+		}),
+		packetsRetransmitted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "reliable_udp_packets_retransmitted_total", Help: "Total segments retransmitted.",
+		}),
+		packetsDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "reliable_udp_packets_dropped_total", Help: "Total packets given up on or discarded as duplicates.",
+		}),
+		packetsDelivered: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "reliable_udp_packets_delivered_total", Help: "Total segments delivered in order to the application.",
+		}),
+		rtt: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "reliable_udp_rtt_seconds", Help: "Sampled round-trip time.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		interArrival: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "reliable_udp_inter_arrival_seconds", Help: "Time between successive inbound packets.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		cwnd: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "reliable_udp_cwnd", Help: "Current congestion window, in segments.",
+		}),
+		inFlightBytes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "reliable_udp_in_flight_bytes", Help: "Bytes sent but not yet acknowledged.",
+		}),
+	}
+	registry.MustRegister(
+		s.packetsSent, s.packetsReceived, s.packetsRetransmitted, s.packetsDropped, s.packetsDelivered,
+		s.rtt, s.interArrival, s.cwnd, s.inFlightBytes,
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	s.server = &http.Server{Addr: addr, Handler: mux}
+	return s, nil
+}
+
+// Serve blocks, serving /metrics until Close is called. Run it in a
+// goroutine registered with the owning FSM's wait group.
+func (s *PrometheusSink) Serve() error {
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *PrometheusSink) IncSent()                            { s.packetsSent.Inc() }
+func (s *PrometheusSink) IncReceived()                        { s.packetsReceived.Inc() }
+func (s *PrometheusSink) IncRetransmitted()                   { s.packetsRetransmitted.Inc() }
+func (s *PrometheusSink) IncDropped()                         { s.packetsDropped.Inc() }
+func (s *PrometheusSink) IncDelivered()                       { s.packetsDelivered.Inc() }
+func (s *PrometheusSink) ObserveRTT(d time.Duration)          { s.rtt.Observe(d.Seconds()) }
+func (s *PrometheusSink) ObserveInterArrival(d time.Duration) { s.interArrival.Observe(d.Seconds()) }
+func (s *PrometheusSink) SetCwnd(v float64)                   { s.cwnd.Set(v) }
+func (s *PrometheusSink) SetInFlightBytes(n int)              { s.inFlightBytes.Set(float64(n)) }
+
+// Close shuts down the /metrics listener, letting Serve return.
+func (s *PrometheusSink) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+var (
+	_ Sink = NopSink{}
+	_ Sink = (*CSVSink)(nil)
+	_ Sink = (*JSONLSink)(nil)
+	_ Sink = (*PrometheusSink)(nil)
+)
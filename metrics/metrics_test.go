@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCSVSinkWritesFinalRowOnClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.csv")
+	sink, err := NewCSVSink(path)
+	if err != nil {
+		t.Fatalf("NewCSVSink: %v", err)
+	}
+
+	sink.IncSent()
+	sink.IncSent()
+	sink.IncReceived()
+	sink.IncDelivered()
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected header + one row, got %d rows: %+v", len(rows), rows)
+	}
+	if got, want := rows[1][1], "2"; got != want {
+		t.Fatalf("Packets Sent column = %q, want %q", got, want)
+	}
+	if got, want := rows[1][6], "100.00%"; got != want {
+		t.Fatalf("Delivery Rate column = %q, want %q", got, want)
+	}
+}
+
+func TestJSONLSinkAppendsOneEventPerLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := NewJSONLSink(path)
+	if err != nil {
+		t.Fatalf("NewJSONLSink: %v", err)
+	}
+
+	sink.IncSent()
+	sink.SetCwnd(4.5)
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	var events []jsonlEvent
+	for scanner.Scan() {
+		var e jsonlEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("unmarshal line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d: %+v", len(events), events)
+	}
+	if events[0].Event != "packets_sent" || events[0].Value != 1 {
+		t.Fatalf("unexpected first event: %+v", events[0])
+	}
+	if events[1].Event != "cwnd" || events[1].Value != 4.5 {
+		t.Fatalf("unexpected second event: %+v", events[1])
+	}
+}
+
+func TestNopSinkSatisfiesSink(t *testing.T) {
+	var sink Sink = NopSink{}
+	sink.IncSent()
+	sink.SetCwnd(1)
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
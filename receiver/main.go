@@ -0,0 +1,51 @@
+// Command receiver is the receiver side of the reliable_UDP protocol: it
+// listens on <ip> <port> and prints the reassembled stream to stdout,
+// using the FSM implemented in the receiverfsm package.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Shun1124/reliable_UDP/metrics"
+	"github.com/Shun1124/reliable_UDP/receiverfsm"
+)
+
+func main() {
+	wireFormat := flag.String("wire", receiverfsm.WireFormatJSON, "wire codec to use: json or binary")
+	metricsAddr := flag.String("metrics-addr", "", "if set, serve Prometheus metrics on this address instead of writing receiver_performance.csv")
+	flag.Parse()
+
+	var sink metrics.Sink
+	var promSink *metrics.PrometheusSink
+	if *metricsAddr != "" {
+		s, err := metrics.NewPrometheusSink(*metricsAddr)
+		if err != nil {
+			fmt.Println("failed to start metrics listener:", err)
+			os.Exit(1)
+		}
+		promSink = s
+		sink = s
+	} else {
+		s, err := metrics.NewCSVSink("receiver_performance.csv")
+		if err != nil {
+			fmt.Println("failed to open receiver_performance.csv:", err)
+			os.Exit(1)
+		}
+		sink = s
+	}
+
+	receiverFSM := receiverfsm.NewReceiverFSM(nil, sink)
+	receiverFSM.SetWireFormat(*wireFormat)
+
+	if promSink != nil {
+		receiverFSM.SpawnBackground(func() {
+			if err := promSink.Serve(); err != nil {
+				fmt.Println("metrics listener error:", err)
+			}
+		})
+	}
+
+	receiverFSM.Run()
+}
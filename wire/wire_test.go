@@ -0,0 +1,50 @@
+package wire
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzEncodeDecode(f *testing.F) {
+	f.Add(uint32(0), uint32(0), byte(0), []byte(""))
+	f.Add(uint32(42), uint32(7), byte(1<<3), []byte("hello world"))
+	f.Fuzz(func(t *testing.T, seq uint32, ack uint32, flags byte, data []byte) {
+		original := &Packet{SeqNum: seq, AckNum: ack, Flags: flags, Data: data}
+		encoded := Encode(original)
+		decoded, err := Decode(encoded)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if decoded.SeqNum != seq || decoded.AckNum != ack || decoded.Flags != flags {
+			t.Fatalf("header mismatch: got %+v", decoded)
+		}
+		if decoded.DataLen != uint32(len(data)) {
+			t.Fatalf("dataLen mismatch: got %d want %d", decoded.DataLen, len(data))
+		}
+		if !bytes.Equal(decoded.Data, data) {
+			t.Fatalf("data mismatch: got %q want %q", decoded.Data, data)
+		}
+	})
+}
+
+func TestDecodeRejectsCorruption(t *testing.T) {
+	encoded := Encode(&Packet{SeqNum: 1, AckNum: 2, Flags: 3, Data: []byte("payload")})
+	encoded[len(encoded)-1] ^= 0xFF // flip a bit inside the CRC-covered trailer
+	if _, err := Decode(encoded); err != ErrChecksumMismatch {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestDecodeRejectsShortFrame(t *testing.T) {
+	if _, err := Decode([]byte{1, 2, 3}); err != ErrShortFrame {
+		t.Fatalf("expected ErrShortFrame, got %v", err)
+	}
+}
+
+func TestDecodeRejectsLengthMismatch(t *testing.T) {
+	encoded := Encode(&Packet{SeqNum: 1, AckNum: 2, Flags: 3, Data: []byte("payload")})
+	truncated := encoded[:len(encoded)-1]
+	if _, err := Decode(truncated); err != ErrLengthMismatch {
+		t.Fatalf("expected ErrLengthMismatch, got %v", err)
+	}
+}
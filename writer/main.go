@@ -0,0 +1,56 @@
+// Command writer is the sender side of the reliable_UDP protocol: it reads
+// stdin and streams it to <ip> <port> over the sliding-window/SACK pipeline
+// implemented in the writerfsm package.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Shun1124/reliable_UDP/metrics"
+	"github.com/Shun1124/reliable_UDP/writerfsm"
+)
+
+func main() {
+	wireFormat := flag.String("wire", writerfsm.WireFormatJSON, "wire codec to use: json or binary")
+	paths := flag.String("paths", "", "comma-separated additional <ip:port> targets to bond as extra paths")
+	metricsAddr := flag.String("metrics-addr", "", "if set, serve Prometheus metrics on this address instead of writing writer_performance.csv")
+	flag.Parse()
+
+	var sink metrics.Sink
+	var promSink *metrics.PrometheusSink
+	if *metricsAddr != "" {
+		s, err := metrics.NewPrometheusSink(*metricsAddr)
+		if err != nil {
+			fmt.Println("failed to start metrics listener:", err)
+			os.Exit(1)
+		}
+		promSink = s
+		sink = s
+	} else {
+		s, err := metrics.NewCSVSink("writer_performance.csv")
+		if err != nil {
+			fmt.Println("failed to open writer_performance.csv:", err)
+			os.Exit(1)
+		}
+		sink = s
+	}
+
+	writerFSM := writerfsm.NewWriterFSM(nil, sink)
+	writerFSM.SetWireFormat(*wireFormat)
+	if *paths != "" {
+		writerFSM.SetPathTargets(strings.Split(*paths, ","))
+	}
+
+	if promSink != nil {
+		writerFSM.SpawnBackground(func() {
+			if err := promSink.Serve(); err != nil {
+				fmt.Println("metrics listener error:", err)
+			}
+		})
+	}
+
+	writerFSM.Run()
+}
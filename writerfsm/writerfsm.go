@@ -0,0 +1,1350 @@
+// Package writerfsm implements the sender side of the reliable_UDP
+// protocol. It is kept importable (rather than package main) so both the
+// writer CLI and tests - including integration tests that wire a
+// WriterFSM and a receiverfsm.ReceiverFSM together over a single
+// fakenet.Pipe - can drive it directly.
+package writerfsm
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shun1124/reliable_UDP/metrics"
+	"github.com/Shun1124/reliable_UDP/wire"
+)
+
+const (
+	positionalArgs = 2 // <ip> <port>
+	maxRetries = 2
+	bufferSize = 1024 * 64
+	packetBufferSize = 2
+	readDeadline = 200 * time.Millisecond
+)
+
+// wire format selection for --wire=json|binary; see the wire package for
+// why binary mode can't yet carry SACK blocks.
+const (
+	wireFormatJSON   = "json"
+	wireFormatBinary = "binary"
+
+	// WireFormatJSON and WireFormatBinary are the exported spellings of the
+	// above, for main's --wire flag default and tests outside this package.
+	WireFormatJSON   = wireFormatJSON
+	WireFormatBinary = wireFormatBinary
+)
+
+/**
+	* 00000001 - ACK
+	* 00000010 - SYN
+	* 00000100 - FIN
+	* 00001000 - DATA
+**/
+
+const (
+	FLAG_ACK = 1 << iota
+	FLAG_SYN
+	FLAG_FIN
+	FLAG_DATA
+)
+
+/////////////////////////sliding-window / congestion-control tuning//////////////////////
+const (
+	initialMSS            = 1024
+	initialCwnd           = 1.0
+	initialSSThresh       = 64.0
+	initialRTO            = 1 * time.Second
+	minRTO                = 200 * time.Millisecond
+	maxRTO                = 60 * time.Second
+	fastRetransmitDupAcks = 3
+	rtoCheckInterval      = 50 * time.Millisecond
+)
+
+//////////////////define custom packet structure//////////////////////
+type CustomPacket struct {
+	Header Header  `json:"header"`
+	Data string    `json:"data"`
+}
+
+// SackBlock reports a contiguous run of bytes the receiver holds beyond
+// the cumulative AckNum, so the sender can fast-retransmit just the gap.
+type SackBlock struct {
+	Start uint32 `json:"start"`
+	End   uint32 `json:"end"`
+}
+
+type Header struct {
+	SeqNum uint32 `json:"seqNum"`
+	AckNum uint32  `json:"ackNum"`
+	DataLen uint32 `json:"dataLen"`
+	Flags byte     `json:"flags"`
+	Sack []SackBlock `json:"sack,omitempty"`
+	// SessionID links the SYN on every bonded path of a multipath sender
+	// back to the same logical stream; zero for a single-path sender.
+	SessionID uint32 `json:"sessionId,omitempty"`
+}
+
+// inFlightSegment tracks a sent-but-unacknowledged segment of the stream.
+type inFlightSegment struct {
+	Data    []byte
+	Flags   byte
+	SentAt  time.Time
+	Retries int
+}
+
+// Path is one bonded link a multipath WriterFSM schedules segments over.
+// Each path keeps its own socket and AIMD/RTT state, mirroring the
+// single-path fields on WriterFSM, so the scheduler can pick whichever
+// path is least loaded for the next segment.
+type Path struct {
+	conn     net.PacketConn
+	addr     net.Addr
+	inFlight map[uint32]*inFlightSegment
+	cwnd     float64
+	ssthresh float64
+	srtt     time.Duration
+	rttvar   time.Duration
+	rto      time.Duration
+}
+
+func newPath(conn net.PacketConn, addr net.Addr) *Path {
+	return &Path{
+		conn:     conn,
+		addr:     addr,
+		inFlight: make(map[uint32]*inFlightSegment),
+		cwnd:     initialCwnd,
+		ssthresh: initialSSThresh,
+		rto:      initialRTO,
+	}
+}
+
+// pathResponse pairs a raw inbound datagram with the bonded Path its
+// listener goroutine read it from, so transmitLoopMultipath knows whose
+// AIMD/RTT state the ACK belongs to.
+type pathResponse struct {
+	path *Path
+	raw  []byte
+}
+
+/////////////////////////define writer FSM///////////////////////////
+type WriterState int
+type WriterFSM struct {
+	err error
+	currentState WriterState
+	ip net.IP
+	port int
+	maxRetries int
+	udpcon net.PacketConn
+	remoteAddr net.Addr
+	dial DialFunc
+	stdinReader *bufio.Reader
+	EOFchan chan struct{} //channel for EOF signal handling
+	responseChan chan []byte //channel for response handling
+	inputChan chan CustomPacket //channel for input handling
+	errorChan chan error //channel for error handling between go routines
+	stopChan chan struct{} //channel for notifying go routines to stop
+	ack uint32
+	seq uint32
+	data string
+	wg sync.WaitGroup
+
+	// sliding-window / congestion-control state, owned solely by transmitLoop
+	inFlight map[uint32]*inFlightSegment
+	cwnd float64
+	ssthresh float64
+	srtt time.Duration
+	rttvar time.Duration
+	rto time.Duration
+	lastAckNum uint32
+	dupAckCount int
+
+	wireFormat string
+
+	// multipath bonding: pathTargets names additional <ip:port> targets
+	// given via --paths. When non-empty, BondPathsState wraps the primary
+	// connection and each additional target into paths and every send
+	// goes through transmitLoopMultipath's scheduler instead of the
+	// single-path fields above.
+	pathTargets []string
+	paths       []*Path
+	sessionID   uint32
+	pathResponseChan chan pathResponse
+
+	// graceful FIN handshake: the FIN segment readStdin enqueues on EOF
+	// rides the normal sliding-window pipeline like any other segment, so
+	// finSeq/finSent/finAcked just track its outcome for FinWaitState.
+	// peerFinChan is closed the first time the receiver's own FIN arrives,
+	// letting WaitPeerFinState proceed to TimeWait.
+	finSeq       uint32
+	finSent      bool
+	finAcked     bool
+	finAckedChan chan struct{}
+	peerFinChan  chan struct{}
+	peerFinOnce  sync.Once
+
+	// metrics receives every send/receive/retransmit event; defaults to
+	// metrics.NopSink{} when NewWriterFSM is given nil, the same fallback
+	// convention DialFunc uses for a real socket.
+	metrics metrics.Sink
+
+	// lastReceivedAtNano is UnixNano of the last inbound packet, accessed
+	// via sync/atomic since listenResponse and, in multipath mode, every
+	// pathListenResponse goroutine all report arrivals concurrently.
+	lastReceivedAtNano int64
+}
+
+const (
+	ValidateArgs WriterState = iota
+	CreateSocket
+	BondPaths
+	SyncronizeServer
+	ReadyForTransmitting
+	Transmitting
+	FinWait
+	WaitPeerFin
+	TimeWait
+	Recover
+	ErrorHandling
+	FatalError
+	Termination
+)
+
+// DialFunc opens the PacketConn a WriterFSM sends segments over and
+// resolves the address it should send them to. The default, used when
+// NewWriterFSM is given nil, opens a real UDP socket; tests inject a
+// fakenet pipe instead so loss/reorder scenarios don't need real sockets.
+type DialFunc func(ip net.IP, port int) (net.PacketConn, net.Addr, error)
+
+func defaultDial(ip net.IP, port int) (net.PacketConn, net.Addr, error) {
+	addr := &net.UDPAddr{IP: ip, Port: port}
+	conn, err := net.ListenUDP("udp", nil)
+	return conn, addr, err
+}
+
+/////////////////////define Methods for WriterFSM for state transitions/////////////////////////
+func NewWriterFSM(dial DialFunc, sink metrics.Sink) *WriterFSM {
+	if dial == nil {
+		dial = defaultDial
+	}
+	if sink == nil {
+		sink = metrics.NopSink{}
+	}
+	return &WriterFSM{
+		currentState: ValidateArgs,
+		maxRetries: maxRetries,
+		dial: dial,
+		stdinReader: bufio.NewReader(os.Stdin),
+		responseChan: make(chan []byte),
+		inputChan: make(chan CustomPacket, packetBufferSize),
+		errorChan: make(chan error),
+		EOFchan: make(chan struct{}),
+		stopChan: make(chan struct{}),
+		ack: 0,
+		seq: 0,
+		data: "",
+		inFlight: make(map[uint32]*inFlightSegment),
+		cwnd: initialCwnd,
+		ssthresh: initialSSThresh,
+		rto: initialRTO,
+		wireFormat: wireFormatJSON,
+		pathResponseChan: make(chan pathResponse),
+		finAckedChan: make(chan struct{}),
+		peerFinChan: make(chan struct{}),
+		metrics: sink,
+	}
+}
+
+func (fsm *WriterFSM) ValidateArgsState() WriterState {
+	posArgs := flag.Args()
+	if len(posArgs) != positionalArgs {
+		fsm.err = errors.New("invalid number of arguments, <ip> <port>")
+		return FatalError
+	}
+	if fsm.wireFormat != wireFormatJSON && fsm.wireFormat != wireFormatBinary {
+		fsm.err = fmt.Errorf("invalid --wire value %q, must be json or binary", fsm.wireFormat)
+		return FatalError
+	}
+	if len(fsm.pathTargets) > 0 && fsm.wireFormat == wireFormatBinary {
+		fsm.err = errors.New("multipath bonding requires --wire=json; binary frames have no room for SessionID")
+		return FatalError
+	}
+	fsm.ip, fsm.err = validateIP(posArgs[0])
+	if fsm.err != nil {
+		return FatalError
+	}
+	fsm.port, fsm.err = validatePort(posArgs[1])
+	if fsm.err != nil {
+		return FatalError
+	}
+	return CreateSocket
+}
+
+func (fsm *WriterFSM) CreateSocketState() WriterState {
+	fsm.udpcon, fsm.remoteAddr, fsm.err = fsm.dial(fsm.ip, fsm.port)
+	if fsm.err != nil {
+		return FatalError
+	}
+	if len(fsm.pathTargets) == 0 {
+		return SyncronizeServer
+	}
+	return BondPaths
+}
+
+// BondPathsState dials every additional --paths target and wraps the
+// primary connection alongside them into fsm.paths, all sharing a single
+// sessionID so the receiver can tell them apart from unrelated clients.
+func (fsm *WriterFSM) BondPathsState() WriterState {
+	fsm.sessionID = newSessionID()
+	fsm.paths = []*Path{newPath(fsm.udpcon, fsm.remoteAddr)}
+	for _, target := range fsm.pathTargets {
+		path, err := fsm.dialPath(target)
+		if err != nil {
+			fsm.err = err
+			return FatalError
+		}
+		fsm.paths = append(fsm.paths, path)
+	}
+	return SyncronizeServer
+}
+
+// dialPath opens an additional bonded path to host:port using the same
+// DialFunc the primary connection uses, so tests can inject a fakenet
+// pipe for extra paths too.
+func (fsm *WriterFSM) dialPath(target string) (*Path, error) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path target %q: %w", target, err)
+	}
+	ip, err := validateIP(host)
+	if err != nil {
+		return nil, err
+	}
+	port, err := validatePort(portStr)
+	if err != nil {
+		return nil, err
+	}
+	conn, addr, err := fsm.dial(ip, port)
+	if err != nil {
+		return nil, err
+	}
+	return newPath(conn, addr), nil
+}
+
+func (fsm *WriterFSM) SyncronizeServerState() WriterState {
+	if len(fsm.paths) > 0 {
+		return fsm.syncronizePathsState()
+	}
+	fsm.wg.Add(1)
+	go fsm.listenResponse()
+	for {
+		packet := createPacket(fsm.ack, fsm.seq, FLAG_SYN, "")
+		raw, err := fsm.encode(packet)
+		if err != nil {
+			fsm.err = err
+			return FatalError
+		}
+		if _, err := fsm.udpcon.WriteTo(raw, fsm.remoteAddr); err != nil {
+			fsm.err = err
+			return FatalError
+		}
+		select {
+			case fsm.err = <- fsm.errorChan:
+				return FatalError
+			case <- fsm.responseChan:
+				return ReadyForTransmitting
+			case <- fsm.stopChan:
+				return Termination
+			case <- time.After(fsm.rto):
+				// no SYN-ACK yet, loop and resend
+		}
+	}
+
+}
+
+// syncronizePathsState is SyncronizeServerState's multipath counterpart:
+// it starts a listener on every bonded path and resends a SessionID-
+// tagged SYN on whichever paths haven't SYN-ACKed yet until all of them
+// have, so the receiver learns the full set of addresses for this
+// session before any path carries data.
+func (fsm *WriterFSM) syncronizePathsState() WriterState {
+	fsm.wg.Add(len(fsm.paths))
+	for _, path := range fsm.paths {
+		go fsm.pathListenResponse(path)
+	}
+
+	confirmed := make(map[*Path]bool, len(fsm.paths))
+	fsm.sendPendingSyns(confirmed)
+	ticker := time.NewTicker(fsm.rto)
+	defer ticker.Stop()
+	for len(confirmed) < len(fsm.paths) {
+		select {
+		case fsm.err = <-fsm.errorChan:
+			return FatalError
+		case resp := <-fsm.pathResponseChan:
+			confirmed[resp.path] = true
+		case <-fsm.stopChan:
+			return Termination
+		case <-ticker.C:
+			fsm.sendPendingSyns(confirmed)
+		}
+	}
+	return ReadyForTransmitting
+}
+
+// sendPendingSyns sends a SYN on every bonded path not yet marked
+// confirmed.
+func (fsm *WriterFSM) sendPendingSyns(confirmed map[*Path]bool) {
+	for _, path := range fsm.paths {
+		if confirmed[path] {
+			continue
+		}
+		packet := createPacket(fsm.ack, fsm.seq, FLAG_SYN, "")
+		packet.Header.SessionID = fsm.sessionID
+		raw, err := fsm.encode(packet)
+		if err != nil {
+			fsm.err = err
+			continue
+		}
+		path.conn.WriteTo(raw, path.addr)
+	}
+}
+
+func (fsm *WriterFSM) ReadyForTransmittingState() WriterState {
+	fsm.wg.Add(2)
+	go fsm.readStdin()
+	if len(fsm.paths) > 0 {
+		go fsm.transmitLoopMultipath()
+	} else {
+		go fsm.transmitLoop()
+	}
+	fmt.Println("Ready for Transmitting")
+	select {
+		case fsm.err = <- fsm.errorChan:
+			return FatalError
+		default:
+			return Transmitting
+	}
+}
+/////////////////////////////////////////////Transmitting State////////////////////////////////////////
+
+func (fsm *WriterFSM) TransmittingState() WriterState {
+	for {
+		select {
+			case <- fsm.EOFchan:
+				return FinWait
+			case fsm.err = <- fsm.errorChan:
+				return ErrorHandling
+
+		}
+	}
+}
+
+// FinWaitState waits for the FIN segment readStdin enqueued on EOF -
+// already riding the normal sliding-window retransmit path like any other
+// segment - to be cumulatively acked, then moves on to wait for the
+// receiver's own FIN. If the FIN is lost past maxRetries, checkTimeouts
+// reports it on errorChan the same as any other segment.
+func (fsm *WriterFSM) FinWaitState() WriterState {
+	select {
+	case fsm.err = <-fsm.errorChan:
+		return FatalError
+	case <-fsm.finAckedChan:
+		return WaitPeerFin
+	case <-fsm.stopChan:
+		return Termination
+	}
+}
+
+// WaitPeerFinState waits for the receiver's reciprocal FIN. handleAck (or
+// handleAckOnPath) ACKs it and closes peerFinChan as soon as it arrives;
+// if the receiver's FIN never shows up, this gives up after maxRetries
+// RTOs and closes anyway rather than hanging forever.
+func (fsm *WriterFSM) WaitPeerFinState() WriterState {
+	ticker := time.NewTicker(fsm.rto)
+	defer ticker.Stop()
+	retries := 0
+	for {
+		select {
+		case fsm.err = <-fsm.errorChan:
+			return FatalError
+		case <-fsm.peerFinChan:
+			return TimeWait
+		case <-fsm.stopChan:
+			return Termination
+		case <-ticker.C:
+			retries++
+			if retries >= fsm.maxRetries {
+				return TimeWait
+			}
+		}
+	}
+}
+
+// TimeWaitState holds the socket open for 2*RTO after both FINs have
+// crossed, the same reason TCP's TIME_WAIT does: if the receiver didn't
+// get our ACK of its FIN, it retransmits the FIN and handleAck re-acks it
+// during this window instead of the retransmit being met with silence.
+func (fsm *WriterFSM) TimeWaitState() WriterState {
+	select {
+	case fsm.err = <-fsm.errorChan:
+		return FatalError
+	case <-fsm.stopChan:
+		return Termination
+	case <-time.After(2 * fsm.rto):
+		return Termination
+	}
+}
+
+func (fsm *WriterFSM) RecoverState() WriterState {
+	fsm.stopChan = make(chan struct{})
+	if len(fsm.paths) > 0 {
+		fsm.wg.Add(2 + len(fsm.paths))
+		go fsm.readStdin()
+		for _, path := range fsm.paths {
+			go fsm.pathListenResponse(path)
+		}
+		go fsm.transmitLoopMultipath()
+		return Transmitting
+	}
+	fsm.wg.Add(3)
+	go fsm.readStdin()
+	go fsm.listenResponse()
+	go fsm.transmitLoop()
+	return Transmitting
+}
+
+
+func (fsm *WriterFSM) ErrorHandlingState() WriterState {
+		fmt.Println("Error:", fsm.err)
+		close(fsm.stopChan)
+		fsm.wg.Wait()
+		return ReadyForTransmitting
+	}
+
+
+
+func (fsm *WriterFSM) FatalErrorState() WriterState {
+	fmt.Println("Fatal Error:", fsm.err)
+	return Termination
+}
+
+
+
+func (fsm *WriterFSM)TerminateState() {
+	fmt.Println("Termination")
+	close(fsm.stopChan)
+	fmt.Println("notify all go routines to stop")
+	fsm.metrics.Close()
+	fsm.wg.Wait()
+	fsm.udpcon.Close()
+	for _, path := range fsm.paths {
+		if path.conn != fsm.udpcon {
+			path.conn.Close()
+		}
+	}
+	fmt.Println("Client Exiting...")
+}
+
+/////////////////////////////run function for WriterFSM////////////////////////////
+func (fsm *WriterFSM) Run() {
+	for {
+		 select{
+		 case  err := <-fsm.errorChan:
+			  fsm.err = err
+			  fsm.currentState = ErrorHandling
+
+		 default:
+			switch fsm.currentState {
+			case ValidateArgs:
+				fsm.currentState = fsm.ValidateArgsState()
+			case CreateSocket:
+				fsm.currentState = fsm.CreateSocketState()
+			case BondPaths:
+				fsm.currentState = fsm.BondPathsState()
+			case SyncronizeServer:
+				fsm.currentState = fsm.SyncronizeServerState()
+			case ReadyForTransmitting:
+				fsm.currentState = fsm.ReadyForTransmittingState()
+			case Transmitting:
+				fsm.currentState = fsm.TransmittingState()
+			case FinWait:
+				fsm.currentState = fsm.FinWaitState()
+			case WaitPeerFin:
+				fsm.currentState = fsm.WaitPeerFinState()
+			case TimeWait:
+				fsm.currentState = fsm.TimeWaitState()
+			case Recover:
+				fsm.currentState = fsm.RecoverState()
+			case ErrorHandling:
+				fsm.currentState = fsm.ErrorHandlingState()
+			case FatalError:
+				fsm.currentState = fsm.FatalErrorState()
+			case Termination:
+				fsm.TerminateState()
+				return
+			}
+		 }
+	}
+}
+
+/////////////////////////go routines for FSM////////////////////////////
+func (fsm *WriterFSM) readStdin() {
+	defer fsm.wg.Done()
+
+	for {
+		select {
+		case <-fsm.stopChan:
+			fmt.Println("readStdin got stopChan")
+			return
+		default:
+			readResult := make(chan []byte)
+			go func() {
+				inputBuffer := make([]byte, bufferSize)
+				n, _ := fsm.stdinReader.Read(inputBuffer)
+				if n > 0 {
+					readResult <- inputBuffer[:n]
+				} else {
+					close(readResult)
+				}
+			}()
+
+			select {
+			case <-fsm.stopChan:
+				fmt.Println("readStdin got stopChan while reading")
+				return
+			case data, ok := <-readResult:
+				if !ok {
+					fmt.Println("readStdin EOF, sending FIN")
+					fsm.inputChan <- createPacket(fsm.ack, fsm.seq, FLAG_FIN, "")
+					close(fsm.EOFchan)
+					return
+				}
+				// segment the read into MSS-sized chunks so the sliding
+				// window can pipeline them independently
+				for offset := 0; offset < len(data); offset += initialMSS {
+					end := offset + initialMSS
+					if end > len(data) {
+						end = len(data)
+					}
+					chunk := data[offset:end]
+					packet := createPacket(fsm.ack, fsm.seq, FLAG_DATA, string(chunk))
+					fsm.inputChan <- packet
+					fsm.seq += uint32(len(chunk))
+				}
+			}
+		}
+	}
+}
+
+// transmitLoop replaces the old single-slot sendPacket/resendPacket pair
+// with a proper sliding-window pipeline: it keeps at most cwnd segments
+// in flight, grows/shrinks cwnd AIMD-style on ACK/loss, and drives
+// retransmission off an RFC 6298 RTO instead of a fixed timer.
+func (fsm *WriterFSM) transmitLoop() {
+	defer fsm.wg.Done()
+	ticker := time.NewTicker(rtoCheckInterval)
+	defer ticker.Stop()
+	for {
+		var in chan CustomPacket
+		if len(fsm.inFlight) < int(fsm.cwnd) {
+			in = fsm.inputChan
+		}
+		select {
+		case <-fsm.stopChan:
+			fmt.Println("transmitLoop get stopChan")
+			return
+		case packet, ok := <-in:
+			if !ok {
+				return
+			}
+			fsm.sendSegment(packet)
+		case raw := <-fsm.responseChan:
+			fsm.handleAck(raw)
+		case <-ticker.C:
+			fsm.checkTimeouts()
+		}
+	}
+}
+
+func (fsm *WriterFSM) sendSegment(packet CustomPacket) {
+	raw, err := fsm.encode(packet)
+	if err != nil {
+		fsm.errorChan <- err
+		return
+	}
+	if _, err := fsm.udpcon.WriteTo(raw, fsm.remoteAddr); err != nil {
+		fsm.errorChan <- err
+		return
+	}
+	fsm.inFlight[packet.Header.SeqNum] = &inFlightSegment{
+		Data:   []byte(packet.Data),
+		Flags:  packet.Header.Flags,
+		SentAt: time.Now(),
+	}
+	fsm.metrics.IncSent()
+	fsm.metrics.SetInFlightBytes(fsm.inFlightBytes())
+	fsm.noteIfFin(packet.Header)
+}
+
+func (fsm *WriterFSM) retransmitSegment(seq uint32, seg *inFlightSegment) {
+	packet := createPacket(fsm.ack, seq, seg.Flags, string(seg.Data))
+	raw, err := fsm.encode(packet)
+	if err != nil {
+		fsm.errorChan <- err
+		return
+	}
+	if _, err := fsm.udpcon.WriteTo(raw, fsm.remoteAddr); err != nil {
+		fsm.errorChan <- err
+		return
+	}
+	seg.SentAt = time.Now()
+	seg.Retries++
+	fsm.metrics.IncRetransmitted()
+}
+
+// noteReceived records an inbound packet's arrival time and, if a prior
+// arrival was recorded, reports the gap between them. It is called from
+// listenResponse and, in multipath mode, every pathListenResponse
+// goroutine, so it uses sync/atomic rather than a plain time.Time field.
+func (fsm *WriterFSM) noteReceived() {
+	now := time.Now()
+	fsm.metrics.IncReceived()
+	if last := atomic.SwapInt64(&fsm.lastReceivedAtNano, now.UnixNano()); last != 0 {
+		fsm.metrics.ObserveInterArrival(now.Sub(time.Unix(0, last)))
+	}
+}
+
+// inFlightBytes sums the payload size of every segment sent but not yet
+// acknowledged, for the metrics sink's in-flight-bytes gauge.
+func (fsm *WriterFSM) inFlightBytes() int {
+	total := 0
+	for _, seg := range fsm.inFlight {
+		total += len(seg.Data)
+	}
+	return total
+}
+
+func (fsm *WriterFSM) handleAck(raw []byte) {
+	header, err := fsm.decode(raw)
+	if err != nil {
+		return
+	}
+	if header.Flags&FLAG_FIN != 0 {
+		fsm.ackPeerFin(header.SeqNum)
+		return
+	}
+	if header.Flags&FLAG_ACK == 0 {
+		return
+	}
+	progressed := header.AckNum > fsm.lastAckNum
+	fsm.ackUpTo(header.AckNum)
+	for _, block := range header.Sack {
+		fsm.ackRange(block.Start, block.End)
+	}
+	if progressed {
+		fsm.lastAckNum = header.AckNum
+		fsm.dupAckCount = 0
+		fsm.growCwnd()
+	} else if len(header.Sack) > 0 {
+		fsm.dupAckCount++
+		if fsm.dupAckCount == fastRetransmitDupAcks {
+			fsm.fastRetransmit(header.AckNum)
+		}
+	}
+	fsm.metrics.SetCwnd(fsm.cwnd)
+	fsm.metrics.SetInFlightBytes(fsm.inFlightBytes())
+	fsm.checkFinAcked()
+}
+
+// noteIfFin records the FIN segment's SeqNum the first time readStdin's
+// FIN packet is actually sent, so checkFinAcked knows what to watch for.
+func (fsm *WriterFSM) noteIfFin(header Header) {
+	if header.Flags&FLAG_FIN != 0 {
+		fsm.finSeq = header.SeqNum
+		fsm.finSent = true
+	}
+}
+
+// checkFinAcked closes finAckedChan the first time the FIN segment is no
+// longer in flight on any path, letting FinWaitState stop waiting.
+func (fsm *WriterFSM) checkFinAcked() {
+	if !fsm.finSent || fsm.finAcked {
+		return
+	}
+	if _, ok := fsm.inFlight[fsm.finSeq]; ok {
+		return
+	}
+	for _, path := range fsm.paths {
+		if _, ok := path.inFlight[fsm.finSeq]; ok {
+			return
+		}
+	}
+	fsm.finAcked = true
+	close(fsm.finAckedChan)
+}
+
+// ackPeerFin ACKs the receiver's own FIN and wakes WaitPeerFinState. It
+// always resends the ACK, even after the first call, so a retransmitted
+// peer FIN (its ACK was lost) gets re-acked during TimeWaitState.
+func (fsm *WriterFSM) ackPeerFin(peerFinSeq uint32) {
+	packet := createPacket(peerFinSeq+1, fsm.seq, FLAG_ACK, "")
+	if raw, err := fsm.encode(packet); err == nil {
+		fsm.udpcon.WriteTo(raw, fsm.remoteAddr)
+	}
+	fsm.peerFinOnce.Do(func() { close(fsm.peerFinChan) })
+}
+
+// ackUpTo removes every in-flight segment fully covered by the cumulative
+// AckNum and samples RTT from the first non-retransmitted one it finds
+// (Karn's algorithm: retransmitted segments can't yield a clean sample).
+func (fsm *WriterFSM) ackUpTo(ackNum uint32) {
+	for seq, seg := range fsm.inFlight {
+		if seq+uint32(len(seg.Data)) <= ackNum {
+			if seg.Retries == 0 {
+				fsm.updateRTO(time.Since(seg.SentAt))
+			}
+			delete(fsm.inFlight, seq)
+		}
+	}
+}
+
+// ackRange removes in-flight segments reported via SACK as already held
+// by the receiver, even though they are beyond the cumulative AckNum.
+func (fsm *WriterFSM) ackRange(start, end uint32) {
+	for seq, seg := range fsm.inFlight {
+		if seq >= start && seq+uint32(len(seg.Data)) <= end {
+			if seg.Retries == 0 {
+				fsm.updateRTO(time.Since(seg.SentAt))
+			}
+			delete(fsm.inFlight, seq)
+		}
+	}
+}
+
+func (fsm *WriterFSM) growCwnd() {
+	if fsm.cwnd < fsm.ssthresh {
+		fsm.cwnd++ // slow start
+	} else {
+		fsm.cwnd += 1 / fsm.cwnd // congestion avoidance, additive increase
+	}
+}
+
+// fastRetransmit fires when three duplicate cumulative ACKs (each
+// carrying a SACK block for data past the gap) confirm a single segment
+// was lost, without waiting for its RTO to expire.
+func (fsm *WriterFSM) fastRetransmit(missingSeq uint32) {
+	seg, ok := fsm.inFlight[missingSeq]
+	if !ok {
+		return
+	}
+	fsm.ssthresh = fsm.cwnd / 2
+	if fsm.ssthresh < 2 {
+		fsm.ssthresh = 2
+	}
+	fsm.cwnd = fsm.ssthresh
+	fsm.retransmitSegment(missingSeq, seg)
+	fsm.metrics.SetCwnd(fsm.cwnd)
+}
+
+func (fsm *WriterFSM) checkTimeouts() {
+	now := time.Now()
+	for seq, seg := range fsm.inFlight {
+		if now.Sub(seg.SentAt) < fsm.rto {
+			continue
+		}
+		if seg.Retries >= fsm.maxRetries {
+			fsm.metrics.IncDropped()
+			fsm.errorChan <- fmt.Errorf("max retries exceeded for segment seq=%d", seq)
+			return
+		}
+		// timeout-triggered loss: halve cwnd, drop back to slow start
+		fsm.ssthresh = fsm.cwnd / 2
+		if fsm.ssthresh < 2 {
+			fsm.ssthresh = 2
+		}
+		fsm.cwnd = 1
+		fsm.retransmitSegment(seq, seg)
+		fsm.metrics.SetCwnd(fsm.cwnd)
+	}
+}
+
+// updateRTO recomputes SRTT/RTTVAR/RTO from a fresh RTT sample per RFC 6298.
+func (fsm *WriterFSM) updateRTO(sample time.Duration) {
+	if fsm.srtt == 0 {
+		fsm.srtt = sample
+		fsm.rttvar = sample / 2
+	} else {
+		diff := fsm.srtt - sample
+		if diff < 0 {
+			diff = -diff
+		}
+		fsm.rttvar = (3*fsm.rttvar + diff) / 4
+		fsm.srtt = (7*fsm.srtt + sample) / 8
+	}
+	rto := fsm.srtt + 4*fsm.rttvar
+	if rto < minRTO {
+		rto = minRTO
+	}
+	if rto > maxRTO {
+		rto = maxRTO
+	}
+	fsm.rto = rto
+	fsm.metrics.ObserveRTT(sample)
+}
+
+func (fsm *WriterFSM) listenResponse() {
+	defer fsm.wg.Done()
+	for {
+		select {
+		case <-fsm.stopChan:
+			fmt.Println("listenResponse get stopChan")
+			return
+		default:
+			fsm.udpcon.SetReadDeadline(time.Now().Add(readDeadline))
+			buffer := make([]byte, bufferSize)
+			n, _, err := fsm.udpcon.ReadFrom(buffer)
+			if err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					continue
+				}
+				 if netErr, ok := err.(net.Error);ok && net.ErrClosed == netErr {
+					fmt.Println("connection closed")
+					fsm.errorChan <- err
+					return
+				}
+				if netErr, ok := err.(net.Error); ok && strings.Contains(netErr.Error(), "connection refused"){
+					fmt.Println("connection refused")
+					fsm.errorChan <- err
+					return
+
+				}
+				fsm.errorChan <- err
+				return
+			}
+
+			fsm.noteReceived()
+			fsm.responseChan <- buffer[:n]
+		}
+	}
+}
+
+// pathListenResponse is listenResponse's multipath counterpart: one
+// instance runs per bonded path for the life of the session, tagging
+// every inbound datagram with the path it arrived on before handing it
+// to transmitLoopMultipath.
+func (fsm *WriterFSM) pathListenResponse(path *Path) {
+	defer fsm.wg.Done()
+	for {
+		select {
+		case <-fsm.stopChan:
+			return
+		default:
+			path.conn.SetReadDeadline(time.Now().Add(readDeadline))
+			buffer := make([]byte, bufferSize)
+			n, _, err := path.conn.ReadFrom(buffer)
+			if err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					continue
+				}
+				fsm.errorChan <- err
+				return
+			}
+			fsm.noteReceived()
+			fsm.pathResponseChan <- pathResponse{path: path, raw: buffer[:n]}
+		}
+	}
+}
+
+// transmitLoopMultipath is transmitLoop's multipath counterpart: instead
+// of a single cwnd/inFlight pair it asks selectPath for whichever bonded
+// path has the lowest estimated time to drain its queue, and demultiplexes
+// ACKs arriving on any path back to that path's own AIMD/RTT state.
+func (fsm *WriterFSM) transmitLoopMultipath() {
+	defer fsm.wg.Done()
+	ticker := time.NewTicker(rtoCheckInterval)
+	defer ticker.Stop()
+	for {
+		var in chan CustomPacket
+		path := fsm.selectPath()
+		if path != nil {
+			in = fsm.inputChan
+		}
+		select {
+		case <-fsm.stopChan:
+			fmt.Println("transmitLoopMultipath get stopChan")
+			return
+		case packet, ok := <-in:
+			if !ok {
+				return
+			}
+			fsm.sendSegmentOnPath(path, packet)
+		case resp := <-fsm.pathResponseChan:
+			fsm.handleAckOnPath(resp.raw)
+		case <-ticker.C:
+			fsm.checkTimeoutsMultipath()
+		}
+	}
+}
+
+// selectPath picks the bonded path with the lowest estimated time to
+// drain its current queue (in_flight/cwnd*srtt), the same heuristic
+// multipath TCP schedulers use to balance a slow path against a fast one.
+// It returns nil if every path is already at its congestion window.
+func (fsm *WriterFSM) selectPath() *Path {
+	var best *Path
+	var bestETA time.Duration
+	for _, path := range fsm.paths {
+		if len(path.inFlight) >= int(path.cwnd) {
+			continue
+		}
+		eta := time.Duration(float64(len(path.inFlight)) / path.cwnd * float64(path.srtt))
+		if best == nil || eta < bestETA {
+			best, bestETA = path, eta
+		}
+	}
+	return best
+}
+
+func (fsm *WriterFSM) sendSegmentOnPath(path *Path, packet CustomPacket) {
+	packet.Header.SessionID = fsm.sessionID
+	raw, err := fsm.encode(packet)
+	if err != nil {
+		fsm.errorChan <- err
+		return
+	}
+	if _, err := path.conn.WriteTo(raw, path.addr); err != nil {
+		fsm.errorChan <- err
+		return
+	}
+	path.inFlight[packet.Header.SeqNum] = &inFlightSegment{
+		Data:   []byte(packet.Data),
+		Flags:  packet.Header.Flags,
+		SentAt: time.Now(),
+	}
+	fsm.metrics.IncSent()
+	fsm.metrics.SetInFlightBytes(fsm.totalInFlightBytes())
+	fsm.noteIfFin(packet.Header)
+}
+
+func (fsm *WriterFSM) retransmitSegmentOnPath(path *Path, seq uint32, seg *inFlightSegment) {
+	packet := createPacket(fsm.ack, seq, seg.Flags, string(seg.Data))
+	packet.Header.SessionID = fsm.sessionID
+	raw, err := fsm.encode(packet)
+	if err != nil {
+		fsm.errorChan <- err
+		return
+	}
+	if _, err := path.conn.WriteTo(raw, path.addr); err != nil {
+		fsm.errorChan <- err
+		return
+	}
+	seg.SentAt = time.Now()
+	path.inFlight[seq] = seg
+	fsm.metrics.IncRetransmitted()
+}
+
+// handleAckOnPath applies an ACK to every bonded path's in-flight set,
+// not just the one it arrived on: the SeqNum space is global across
+// paths, so a cumulative ACK or SACK block can cover segments that were
+// sent on a different path than the one that just reported them received.
+func (fsm *WriterFSM) handleAckOnPath(raw []byte) {
+	header, err := fsm.decode(raw)
+	if err != nil {
+		return
+	}
+	if header.Flags&FLAG_FIN != 0 {
+		fsm.ackPeerFin(header.SeqNum)
+		return
+	}
+	if header.Flags&FLAG_ACK == 0 {
+		return
+	}
+	progressed := header.AckNum > fsm.lastAckNum
+	for _, path := range fsm.paths {
+		cleared := ackUpToOnPath(path, header.AckNum, fsm.metrics)
+		for _, block := range header.Sack {
+			if ackRangeOnPath(path, block.Start, block.End, fsm.metrics) {
+				cleared = true
+			}
+		}
+		if cleared && progressed {
+			growCwndOnPath(path)
+		}
+	}
+	if progressed {
+		fsm.lastAckNum = header.AckNum
+		fsm.dupAckCount = 0
+	} else if len(header.Sack) > 0 {
+		fsm.dupAckCount++
+		if fsm.dupAckCount == fastRetransmitDupAcks {
+			fsm.fastRetransmitMultipath(header.AckNum)
+		}
+	}
+	fsm.metrics.SetCwnd(fsm.totalCwnd())
+	fsm.metrics.SetInFlightBytes(fsm.totalInFlightBytes())
+	fsm.checkFinAcked()
+}
+
+// totalCwnd sums every bonded path's congestion window for the metrics
+// sink's cwnd gauge, since multipath sends don't have a single cwnd the
+// way a single-path session does.
+func (fsm *WriterFSM) totalCwnd() float64 {
+	total := 0.0
+	for _, path := range fsm.paths {
+		total += path.cwnd
+	}
+	return total
+}
+
+// totalInFlightBytes is totalCwnd's in-flight-bytes counterpart.
+func (fsm *WriterFSM) totalInFlightBytes() int {
+	total := 0
+	for _, path := range fsm.paths {
+		for _, seg := range path.inFlight {
+			total += len(seg.Data)
+		}
+	}
+	return total
+}
+
+// fastRetransmitMultipath mirrors fastRetransmit: it halves the cwnd of
+// whichever path the missing segment was sent on, then resends it via
+// selectPath so a path that has gone bad doesn't just keep swallowing its
+// own retransmits.
+func (fsm *WriterFSM) fastRetransmitMultipath(missingSeq uint32) {
+	for _, path := range fsm.paths {
+		seg, ok := path.inFlight[missingSeq]
+		if !ok {
+			continue
+		}
+		path.ssthresh = path.cwnd / 2
+		if path.ssthresh < 2 {
+			path.ssthresh = 2
+		}
+		path.cwnd = path.ssthresh
+		delete(path.inFlight, missingSeq)
+		target := fsm.selectPath()
+		if target == nil {
+			target = path
+		}
+		fsm.retransmitSegmentOnPath(target, missingSeq, seg)
+		fsm.metrics.SetCwnd(fsm.totalCwnd())
+		return
+	}
+}
+
+// checkTimeoutsMultipath mirrors checkTimeouts per path, but retransmits
+// a timed-out segment via selectPath rather than back onto the path that
+// lost it: this is what lets a second path absorb the load of a path
+// that has gone bad instead of retrying into the same blackhole.
+func (fsm *WriterFSM) checkTimeoutsMultipath() {
+	now := time.Now()
+	for _, path := range fsm.paths {
+		for seq, seg := range path.inFlight {
+			if now.Sub(seg.SentAt) < path.rto {
+				continue
+			}
+			if seg.Retries >= fsm.maxRetries {
+				fsm.metrics.IncDropped()
+				fsm.errorChan <- fmt.Errorf("max retries exceeded for segment seq=%d", seq)
+				return
+			}
+			path.ssthresh = path.cwnd / 2
+			if path.ssthresh < 2 {
+				path.ssthresh = 2
+			}
+			path.cwnd = 1
+			delete(path.inFlight, seq)
+			seg.Retries++
+			target := fsm.selectPath()
+			if target == nil {
+				target = path
+			}
+			fsm.retransmitSegmentOnPath(target, seq, seg)
+			fsm.metrics.SetCwnd(fsm.totalCwnd())
+		}
+	}
+}
+
+// ackUpToOnPath is ackUpTo's per-Path counterpart; it reports whether it
+// cleared anything so the caller knows whether to grow that path's cwnd.
+func ackUpToOnPath(path *Path, ackNum uint32, sink metrics.Sink) bool {
+	cleared := false
+	for seq, seg := range path.inFlight {
+		if seq+uint32(len(seg.Data)) <= ackNum {
+			if seg.Retries == 0 {
+				updateRTOOnPath(path, time.Since(seg.SentAt), sink)
+			}
+			delete(path.inFlight, seq)
+			cleared = true
+		}
+	}
+	return cleared
+}
+
+// ackRangeOnPath is ackRange's per-Path counterpart.
+func ackRangeOnPath(path *Path, start, end uint32, sink metrics.Sink) bool {
+	cleared := false
+	for seq, seg := range path.inFlight {
+		if seq >= start && seq+uint32(len(seg.Data)) <= end {
+			if seg.Retries == 0 {
+				updateRTOOnPath(path, time.Since(seg.SentAt), sink)
+			}
+			delete(path.inFlight, seq)
+			cleared = true
+		}
+	}
+	return cleared
+}
+
+func growCwndOnPath(path *Path) {
+	if path.cwnd < path.ssthresh {
+		path.cwnd++ // slow start
+	} else {
+		path.cwnd += 1 / path.cwnd // congestion avoidance, additive increase
+	}
+}
+
+// updateRTOOnPath is updateRTO's per-Path counterpart.
+func updateRTOOnPath(path *Path, sample time.Duration, sink metrics.Sink) {
+	sink.ObserveRTT(sample)
+	if path.srtt == 0 {
+		path.srtt = sample
+		path.rttvar = sample / 2
+	} else {
+		diff := path.srtt - sample
+		if diff < 0 {
+			diff = -diff
+		}
+		path.rttvar = (3*path.rttvar + diff) / 4
+		path.srtt = (7*path.srtt + sample) / 8
+	}
+	rto := path.srtt + 4*path.rttvar
+	if rto < minRTO {
+		rto = minRTO
+	}
+	if rto > maxRTO {
+		rto = maxRTO
+	}
+	path.rto = rto
+}
+
+////////////////////////////////helper functions///////////////////////////////
+func validateIP(ip string) (net.IP, error){
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, errors.New("invalid ip address")
+	}
+	return addr, nil
+}
+
+func validatePort(port string) (int, error) {
+	portNo, err := strconv.Atoi(port)
+	if err != nil || portNo < 0 || portNo > 65535 {
+		return -1, errors.New("invalid port number")
+	}
+	return portNo, nil
+}
+
+// newSessionID generates the SessionID a multipath sender tags every
+// bonded path's SYN with so the receiver can tell them apart.
+func newSessionID() uint32 {
+	return uint32(time.Now().UnixNano())
+}
+
+func createPacket(ack uint32, seq uint32, flags byte, data string) CustomPacket {
+	packet := CustomPacket{
+		Header: Header{
+			SeqNum: seq,
+			AckNum: ack,
+			DataLen: uint32(len(data)),
+			Flags: flags,
+		},
+		Data: data,
+
+	}
+	return packet
+
+}
+
+
+// encode serializes packet using whichever wire format was selected on
+// the command line.
+func (fsm *WriterFSM) encode(packet CustomPacket) ([]byte, error) {
+	if fsm.wireFormat == wireFormatBinary {
+		return wire.Encode(&wire.Packet{
+			SeqNum:  packet.Header.SeqNum,
+			AckNum:  packet.Header.AckNum,
+			DataLen: packet.Header.DataLen,
+			Flags:   packet.Header.Flags,
+			Data:    []byte(packet.Data),
+		}), nil
+	}
+	return json.Marshal(packet)
+}
+
+// decode parses a response header using whichever wire format was
+// selected on the command line.
+func (fsm *WriterFSM) decode(response []byte) (*Header, error) {
+	if fsm.wireFormat == wireFormatBinary {
+		p, err := wire.Decode(response)
+		if err != nil {
+			return nil, err
+		}
+		return &Header{SeqNum: p.SeqNum, AckNum: p.AckNum, DataLen: p.DataLen, Flags: p.Flags}, nil
+	}
+	var packet CustomPacket
+	if err := json.Unmarshal(response, &packet); err != nil {
+		return nil, err
+	}
+	return &packet.Header, nil
+}
+
+// SetWireFormat selects the --wire codec (json or binary); called by main
+// before Run(), and by tests that want binary framing.
+func (fsm *WriterFSM) SetWireFormat(format string) {
+	fsm.wireFormat = format
+}
+
+// SetPathTargets configures additional bonded <ip:port> targets for
+// multipath mode; called by main before Run().
+func (fsm *WriterFSM) SetPathTargets(targets []string) {
+	fsm.pathTargets = targets
+}
+
+// SetInput overrides what readStdin reads from, defaulting to os.Stdin;
+// used by integration tests that feed a fakenet-backed WriterFSM from an
+// in-memory buffer instead of the process's real stdin.
+func (fsm *WriterFSM) SetInput(r io.Reader) {
+	fsm.stdinReader = bufio.NewReader(r)
+}
+
+// SetMaxRetries overrides how many times checkTimeouts retransmits a
+// segment before giving up, defaulting to the conservative production
+// value of maxRetries; tests exercising heavy loss need more than that
+// default allows before a single unlucky segment aborts the transfer.
+func (fsm *WriterFSM) SetMaxRetries(n int) {
+	fsm.maxRetries = n
+}
+
+// SpawnBackground runs f in a goroutine tracked by the FSM's shutdown
+// WaitGroup, the same one Run()'s own goroutines use, so main can register
+// auxiliary work (like the Prometheus listener) without reaching into
+// unexported fields.
+func (fsm *WriterFSM) SpawnBackground(f func()) {
+	fsm.wg.Add(1)
+	go func() {
+		defer fsm.wg.Done()
+		f()
+	}()
+}
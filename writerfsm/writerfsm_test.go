@@ -0,0 +1,553 @@
+package writerfsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shun1124/reliable_UDP/fakenet"
+)
+
+func newTestWriterFSM(t *testing.T) *WriterFSM {
+	t.Helper()
+	fsm := NewWriterFSM(nil, nil)
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fsm.udpcon = conn
+	fsm.remoteAddr = addr
+	return fsm
+}
+
+func TestGrowCwndSlowStartThenCongestionAvoidance(t *testing.T) {
+	fsm := newTestWriterFSM(t)
+	fsm.cwnd = 1
+	fsm.ssthresh = 4
+
+	fsm.growCwnd() // 1 -> 2, slow start
+	fsm.growCwnd() // 2 -> 3, slow start
+	fsm.growCwnd() // 3 -> 4, slow start
+	if fsm.cwnd != 4 {
+		t.Fatalf("expected cwnd 4 after slow start, got %v", fsm.cwnd)
+	}
+
+	fsm.growCwnd() // cwnd == ssthresh, switches to additive increase
+	want := 4 + 1.0/4.0
+	if fsm.cwnd != want {
+		t.Fatalf("expected cwnd %v after congestion avoidance step, got %v", want, fsm.cwnd)
+	}
+}
+
+func TestUpdateRTOClampsToBounds(t *testing.T) {
+	fsm := newTestWriterFSM(t)
+
+	fsm.updateRTO(1 * time.Millisecond)
+	if fsm.rto != minRTO {
+		t.Fatalf("expected rto clamped to minRTO, got %v", fsm.rto)
+	}
+
+	fsm.srtt = 0
+	fsm.rttvar = 0
+	fsm.updateRTO(1 * time.Hour)
+	if fsm.rto != maxRTO {
+		t.Fatalf("expected rto clamped to maxRTO, got %v", fsm.rto)
+	}
+}
+
+func TestAckUpToRemovesFullyCoveredSegments(t *testing.T) {
+	fsm := newTestWriterFSM(t)
+	fsm.inFlight[0] = &inFlightSegment{Data: make([]byte, 10), SentAt: time.Now()}
+	fsm.inFlight[10] = &inFlightSegment{Data: make([]byte, 10), SentAt: time.Now()}
+
+	fsm.ackUpTo(10)
+	if _, ok := fsm.inFlight[0]; ok {
+		t.Fatalf("segment at 0 should have been acked")
+	}
+	if _, ok := fsm.inFlight[10]; !ok {
+		t.Fatalf("segment at 10 should still be in flight")
+	}
+}
+
+func TestAckRangeHandlesSackBeyondCumulativeAck(t *testing.T) {
+	fsm := newTestWriterFSM(t)
+	fsm.inFlight[0] = &inFlightSegment{Data: make([]byte, 10), SentAt: time.Now()}
+	fsm.inFlight[20] = &inFlightSegment{Data: make([]byte, 10), SentAt: time.Now()}
+
+	fsm.ackRange(20, 30)
+	if _, ok := fsm.inFlight[0]; !ok {
+		t.Fatalf("segment at 0 is still an unacked gap, must remain in flight")
+	}
+	if _, ok := fsm.inFlight[20]; ok {
+		t.Fatalf("segment at 20 was covered by the SACK block and should be removed")
+	}
+}
+
+func TestHandleAckThreeDupAcksTriggersFastRetransmit(t *testing.T) {
+	fsm := newTestWriterFSM(t)
+	fsm.inFlight[0] = &inFlightSegment{Data: make([]byte, 10), SentAt: time.Now()}
+	fsm.inFlight[10] = &inFlightSegment{Data: make([]byte, 10), SentAt: time.Now()}
+	fsm.lastAckNum = 0
+	fsm.cwnd = 8
+	fsm.ssthresh = 64
+
+	dupAck := func() []byte {
+		raw, _ := json.Marshal(CustomPacket{Header: Header{
+			AckNum: 0,
+			Flags:  FLAG_ACK,
+			Sack:   []SackBlock{{Start: 10, End: 20}},
+		}})
+		return raw
+	}
+
+	fsm.handleAck(dupAck())
+	fsm.handleAck(dupAck())
+	if fsm.dupAckCount != 2 {
+		t.Fatalf("expected dupAckCount 2, got %d", fsm.dupAckCount)
+	}
+	fsm.handleAck(dupAck())
+	if fsm.dupAckCount != 3 {
+		t.Fatalf("expected dupAckCount 3, got %d", fsm.dupAckCount)
+	}
+	if fsm.cwnd != fsm.ssthresh {
+		t.Fatalf("expected fast retransmit to drop cwnd to ssthresh, cwnd=%v ssthresh=%v", fsm.cwnd, fsm.ssthresh)
+	}
+}
+
+// TestTransmitLoopDeliversAllBytesOverLossyFakeTransport drives the real
+// transmitLoop/listenResponse goroutines over a fakenet.Pipe instead of a
+// real UDP socket, against a minimal simulated receiver, and checks that
+// every byte of the stream still arrives once loss reaches 50%.
+func TestTransmitLoopDeliversAllBytesOverLossyFakeTransport(t *testing.T) {
+	message := strings.Repeat("the quick brown fox jumps over the lazy dog. ", 40)
+
+	for _, lossProbability := range []float64{0.05, 0.2, 0.5} {
+		t.Run(fmt.Sprintf("loss=%v", lossProbability), func(t *testing.T) {
+			client, server := fakenet.Pipe("client", "server", fakenet.Config{
+				DropProbability: lossProbability,
+				Delay:           time.Millisecond,
+				Rand:            rand.New(rand.NewSource(1)),
+			})
+			defer client.Close()
+			defer server.Close()
+
+			fsm := NewWriterFSM(nil, nil)
+			fsm.udpcon = client
+			fsm.remoteAddr = server.LocalAddr()
+			fsm.rto = 20 * time.Millisecond // override the 1s default so retries happen fast enough for a test
+			fsm.maxRetries = 1000           // 50% loss needs more than the production default of 2 retries
+
+			fsm.wg.Add(2)
+			go fsm.listenResponse()
+			go fsm.transmitLoop()
+			// listenResponse/transmitLoop may still be mid-send on an
+			// unbuffered channel when the test ends, so just signal stop
+			// and let them unwind in the background rather than risk
+			// wg.Wait() deadlocking on a send nobody is left to receive.
+			defer close(fsm.stopChan)
+
+			go func() {
+				for offset := 0; offset < len(message); offset += initialMSS {
+					end := offset + initialMSS
+					if end > len(message) {
+						end = len(message)
+					}
+					chunk := message[offset:end]
+					fsm.inputChan <- createPacket(fsm.ack, fsm.seq, FLAG_DATA, chunk)
+					fsm.seq += uint32(len(chunk))
+				}
+			}()
+
+			got := simulateReceiver(t, server, len(message))
+			if got != message {
+				t.Fatalf("reconstructed %d bytes, want %d", len(got), len(message))
+			}
+		})
+	}
+}
+
+// simulateReceiver is a minimal stand-in for the real ReceiverFSM: it
+// reassembles contiguous DATA segments arriving on conn and replies with a
+// cumulative ACK, until it has reassembled want bytes or the test deadline
+// passes.
+func simulateReceiver(t *testing.T, conn net.PacketConn, want int) string {
+	t.Helper()
+	reassembly := make(map[uint32][]byte)
+	var ackNum uint32
+	assembled := make([]byte, 0, want)
+	buffer := make([]byte, bufferSize)
+	deadline := time.Now().Add(10 * time.Second)
+
+	for len(assembled) < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out after reassembling %d/%d bytes", len(assembled), want)
+		}
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			continue
+		}
+		var packet CustomPacket
+		if err := json.Unmarshal(buffer[:n], &packet); err != nil {
+			continue
+		}
+		if packet.Header.Flags&FLAG_DATA != 0 {
+			seq := packet.Header.SeqNum
+			if seq >= ackNum {
+				if _, exists := reassembly[seq]; !exists {
+					reassembly[seq] = []byte(packet.Data)
+				}
+			}
+			for {
+				chunk, ok := reassembly[ackNum]
+				if !ok {
+					break
+				}
+				assembled = append(assembled, chunk...)
+				delete(reassembly, ackNum)
+				ackNum += uint32(len(chunk))
+			}
+		}
+		raw, _ := json.Marshal(createPacket(ackNum, 0, FLAG_ACK, ""))
+		conn.WriteTo(raw, addr)
+	}
+	return string(assembled)
+}
+
+// TestTransmitLoopPipelinesMultipleSegmentsWithOpenCwnd proves the sliding
+// window actually pipelines rather than degenerating back to stop-and-wait:
+// with cwnd opened past 1, the writer must have more than one segment
+// unacknowledged at once, which a single-lastPacket-slot sender could never
+// do regardless of how many bytes were queued.
+func TestTransmitLoopPipelinesMultipleSegmentsWithOpenCwnd(t *testing.T) {
+	// enough segments that cwnd=8 below is the bottleneck, not the data size
+	message := strings.Repeat("the quick brown fox jumps over the lazy dog. ", 400)
+
+	client, server := fakenet.Pipe("client", "server", fakenet.Config{Delay: time.Millisecond})
+	defer client.Close()
+	defer server.Close()
+
+	const openCwnd = 8 // simulate a window already opened by prior ACKs
+
+	fsm := NewWriterFSM(nil, nil)
+	fsm.udpcon = client
+	fsm.remoteAddr = server.LocalAddr()
+	fsm.rto = 20 * time.Millisecond
+	fsm.cwnd = openCwnd
+
+	fsm.wg.Add(2)
+	go fsm.listenResponse()
+	go fsm.transmitLoop()
+	defer close(fsm.stopChan)
+
+	go func() {
+		for offset := 0; offset < len(message); offset += initialMSS {
+			end := offset + initialMSS
+			if end > len(message) {
+				end = len(message)
+			}
+			chunk := message[offset:end]
+			fsm.inputChan <- createPacket(fsm.ack, fsm.seq, FLAG_DATA, chunk)
+			fsm.seq += uint32(len(chunk))
+		}
+	}()
+
+	maxBurst := simulateStallingReceiver(t, server, len(message))
+	if maxBurst < openCwnd/2 {
+		t.Fatalf("expected a burst close to cwnd=%v in flight at once, saw a max burst of %d - sender is not pipelining", openCwnd, maxBurst)
+	}
+}
+
+// simulateStallingReceiver is simulateReceiver plus bookkeeping: it withholds
+// every ACK for a fixed window and counts how many distinct segments arrive
+// during that window. A stop-and-wait sender could only ever get exactly
+// one segment across before stalling on the withheld ACK; this count is >1
+// only if the sender actually pipelines.
+func simulateStallingReceiver(t *testing.T, conn net.PacketConn, want int) int {
+	t.Helper()
+	reassembly := make(map[uint32][]byte)
+	var ackNum uint32
+	assembled := make([]byte, 0, want)
+	buffer := make([]byte, bufferSize)
+	deadline := time.Now().Add(10 * time.Second)
+
+	seenBeforeFirstAck := make(map[uint32]bool)
+	firstAckSent := false
+	withholdUntil := time.Now().Add(50 * time.Millisecond)
+
+	for len(assembled) < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out after reassembling %d/%d bytes", len(assembled), want)
+		}
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			continue
+		}
+		var packet CustomPacket
+		if err := json.Unmarshal(buffer[:n], &packet); err != nil {
+			continue
+		}
+		if packet.Header.Flags&FLAG_DATA != 0 {
+			seq := packet.Header.SeqNum
+			if !firstAckSent {
+				seenBeforeFirstAck[seq] = true
+			}
+			if seq >= ackNum {
+				if _, exists := reassembly[seq]; !exists {
+					reassembly[seq] = []byte(packet.Data)
+				}
+			}
+			for {
+				chunk, ok := reassembly[ackNum]
+				if !ok {
+					break
+				}
+				assembled = append(assembled, chunk...)
+				delete(reassembly, ackNum)
+				ackNum += uint32(len(chunk))
+			}
+		}
+		if !firstAckSent && time.Now().Before(withholdUntil) {
+			continue
+		}
+		firstAckSent = true
+		raw, _ := json.Marshal(createPacket(ackNum, 0, FLAG_ACK, ""))
+		conn.WriteTo(raw, addr)
+	}
+	maxBurst := len(seenBeforeFirstAck)
+	return maxBurst
+}
+
+func TestCheckFinAckedClosesChannelOnceFinSegmentCleared(t *testing.T) {
+	fsm := newTestWriterFSM(t)
+	fsm.finSent = true
+	fsm.finSeq = 10
+	fsm.inFlight[10] = &inFlightSegment{Flags: FLAG_FIN, SentAt: time.Now()}
+
+	fsm.checkFinAcked()
+	select {
+	case <-fsm.finAckedChan:
+		t.Fatalf("finAckedChan closed while the FIN segment is still in flight")
+	default:
+	}
+
+	delete(fsm.inFlight, 10)
+	fsm.checkFinAcked()
+	select {
+	case <-fsm.finAckedChan:
+	default:
+		t.Fatalf("expected finAckedChan to be closed once the FIN segment cleared")
+	}
+}
+
+func TestHandleAckDetectsPeerFinAndClosesPeerFinChan(t *testing.T) {
+	fsm := newTestWriterFSM(t)
+
+	finPacket, _ := json.Marshal(CustomPacket{Header: Header{SeqNum: 42, Flags: FLAG_FIN}})
+	fsm.handleAck(finPacket)
+
+	select {
+	case <-fsm.peerFinChan:
+	default:
+		t.Fatalf("expected peerFinChan to be closed after receiving the peer's FIN")
+	}
+}
+
+// TestFinHandshakeCompletesFourWayClose drives the writer FSM's FinWait ->
+// WaitPeerFin -> TimeWait states against a simulated receiver that ACKs
+// the FIN and sends its own back, and checks the FSM reaches Termination
+// instead of hanging or erroring out.
+func TestFinHandshakeCompletesFourWayClose(t *testing.T) {
+	client, server := fakenet.Pipe("client", "server", fakenet.Config{Delay: time.Millisecond})
+	defer client.Close()
+	defer server.Close()
+
+	fsm := NewWriterFSM(nil, nil)
+	fsm.udpcon = client
+	fsm.remoteAddr = server.LocalAddr()
+	fsm.rto = 20 * time.Millisecond
+
+	fsm.wg.Add(2)
+	go fsm.listenResponse()
+	go fsm.transmitLoop()
+	defer close(fsm.stopChan)
+
+	finPacket := createPacket(fsm.ack, fsm.seq, FLAG_FIN, "")
+	fsm.inputChan <- finPacket
+
+	go simulateFinReceiver(server, finPacket.Header.SeqNum)
+
+	state := fsm.FinWaitState()
+	if state != WaitPeerFin {
+		t.Fatalf("expected FinWaitState to reach WaitPeerFin, got %v", state)
+	}
+	state = fsm.WaitPeerFinState()
+	if state != TimeWait {
+		t.Fatalf("expected WaitPeerFinState to reach TimeWait, got %v", state)
+	}
+	state = fsm.TimeWaitState()
+	if state != Termination {
+		t.Fatalf("expected TimeWaitState to reach Termination, got %v", state)
+	}
+}
+
+// simulateFinReceiver ACKs the sender's FIN once, then sends its own FIN
+// back, mirroring the real ReceiverFSM's fin_received_state/closing_state.
+func simulateFinReceiver(conn net.PacketConn, finSeq uint32) {
+	buffer := make([]byte, bufferSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		var packet CustomPacket
+		if json.Unmarshal(buffer[:n], &packet) != nil {
+			continue
+		}
+		if packet.Header.Flags&FLAG_FIN == 0 {
+			continue
+		}
+		raw, _ := json.Marshal(createPacket(finSeq+1, 0, FLAG_ACK, ""))
+		conn.WriteTo(raw, addr)
+		ownFin, _ := json.Marshal(createPacket(0, 0, FLAG_FIN, ""))
+		conn.WriteTo(ownFin, addr)
+		return
+	}
+}
+
+func TestSelectPathPicksPathWithLowestEstimatedCompletion(t *testing.T) {
+	fsm := NewWriterFSM(nil, nil)
+	busy := &Path{cwnd: 2, srtt: 100 * time.Millisecond, inFlight: map[uint32]*inFlightSegment{0: {}, 10: {}}}
+	idle := &Path{cwnd: 2, srtt: 100 * time.Millisecond, inFlight: map[uint32]*inFlightSegment{}}
+	fsm.paths = []*Path{busy, idle}
+
+	if got := fsm.selectPath(); got != idle {
+		t.Fatalf("expected the idle path to be selected, got %+v", got)
+	}
+}
+
+func TestSelectPathReturnsNilWhenAllPathsAreAtCwnd(t *testing.T) {
+	fsm := NewWriterFSM(nil, nil)
+	full := &Path{cwnd: 1, inFlight: map[uint32]*inFlightSegment{0: {}}}
+	fsm.paths = []*Path{full}
+
+	if got := fsm.selectPath(); got != nil {
+		t.Fatalf("expected no path to be selectable, got %+v", got)
+	}
+}
+
+// TestMultipathFailoverAbsorbsBlackholedPath drives a two-path WriterFSM
+// over a pair of fakenet pipes, blackholes one path partway through the
+// transfer, and checks the other path absorbs the rest of the stream
+// within a couple of RTOs instead of the transfer stalling.
+func TestMultipathFailoverAbsorbsBlackholedPath(t *testing.T) {
+	message := strings.Repeat("the quick brown fox jumps over the lazy dog. ", 80)
+
+	primaryClient, primaryServer := fakenet.Pipe("client-a", "server-a", fakenet.Config{
+		Delay: time.Millisecond,
+		Rand:  rand.New(rand.NewSource(1)),
+	})
+	defer primaryClient.Close()
+	defer primaryServer.Close()
+	secondaryClient, secondaryServer := fakenet.Pipe("client-b", "server-b", fakenet.Config{
+		Delay: time.Millisecond,
+		Rand:  rand.New(rand.NewSource(2)),
+	})
+	defer secondaryClient.Close()
+	defer secondaryServer.Close()
+
+	fsm := NewWriterFSM(nil, nil)
+	fsm.rto = 20 * time.Millisecond
+	fsm.maxRetries = 1000
+	fsm.sessionID = 42
+	fsm.paths = []*Path{
+		newPath(primaryClient, primaryServer.LocalAddr()),
+		newPath(secondaryClient, secondaryServer.LocalAddr()),
+	}
+
+	fsm.wg.Add(3)
+	go fsm.pathListenResponse(fsm.paths[0])
+	go fsm.pathListenResponse(fsm.paths[1])
+	go fsm.transmitLoopMultipath()
+	defer close(fsm.stopChan)
+
+	go func() {
+		for offset := 0; offset < len(message); offset += initialMSS {
+			end := offset + initialMSS
+			if end > len(message) {
+				end = len(message)
+			}
+			chunk := message[offset:end]
+			fsm.inputChan <- createPacket(fsm.ack, fsm.seq, FLAG_DATA, chunk)
+			fsm.seq += uint32(len(chunk))
+		}
+	}()
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		primaryClient.SetDropProbability(1)
+	}()
+
+	got := simulateMultipathReceiver(t, []net.PacketConn{primaryServer, secondaryServer}, len(message))
+	if got != message {
+		t.Fatalf("reconstructed %d bytes, want %d", len(got), len(message))
+	}
+}
+
+// simulateMultipathReceiver is a minimal stand-in for the real
+// ReceiverFSM: it reassembles contiguous DATA segments arriving on any of
+// conns, mirroring the global (not per-path) SeqNum space, and ACKs each
+// one back on the conn it arrived on.
+func simulateMultipathReceiver(t *testing.T, conns []net.PacketConn, want int) string {
+	t.Helper()
+	reassembly := make(map[uint32][]byte)
+	var ackNum uint32
+	assembled := make([]byte, 0, want)
+	deadline := time.Now().Add(10 * time.Second)
+
+	for len(assembled) < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out after reassembling %d/%d bytes", len(assembled), want)
+		}
+		for _, conn := range conns {
+			conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+			buffer := make([]byte, bufferSize)
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				continue
+			}
+			var packet CustomPacket
+			if json.Unmarshal(buffer[:n], &packet) != nil {
+				continue
+			}
+			if packet.Header.Flags&FLAG_DATA != 0 {
+				seq := packet.Header.SeqNum
+				if seq >= ackNum {
+					if _, exists := reassembly[seq]; !exists {
+						reassembly[seq] = []byte(packet.Data)
+					}
+				}
+				for {
+					chunk, ok := reassembly[ackNum]
+					if !ok {
+						break
+					}
+					assembled = append(assembled, chunk...)
+					delete(reassembly, ackNum)
+					ackNum += uint32(len(chunk))
+				}
+			}
+			raw, _ := json.Marshal(createPacket(ackNum, 0, FLAG_ACK, ""))
+			conn.WriteTo(raw, addr)
+		}
+	}
+	return string(assembled)
+}